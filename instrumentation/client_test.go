@@ -0,0 +1,87 @@
+package instrumentation
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestInstrumentRoundTripperCounter(t *testing.T) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_requests_total",
+	}, []string{"method", "code"})
+
+	rt := InstrumentRoundTripperCounter(counter, RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusTeapot}, nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+
+	m, err := counter.GetMetricWith(prometheus.Labels{"method": "post", "code": "418"})
+	if err != nil {
+		t.Fatalf("GetMetricWith: %v", err)
+	}
+	var pm dto.Metric
+	if err := m.Write(&pm); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := pm.GetCounter().GetValue(); got != 1 {
+		t.Errorf("counter = %v, want 1", got)
+	}
+}
+
+func TestInstrumentRoundTripperCounterSkipsOnError(t *testing.T) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_requests_total_err",
+	}, []string{"method", "code"})
+
+	wantErr := errors.New("boom")
+	rt := InstrumentRoundTripperCounter(counter, RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, wantErr
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if _, err := rt.RoundTrip(req); err != wantErr {
+		t.Fatalf("RoundTrip err = %v, want %v", err, wantErr)
+	}
+
+	ch := make(chan prometheus.Metric, 1)
+	counter.Collect(ch)
+	close(ch)
+	if n := len(ch); n != 0 {
+		t.Errorf("counter has %d series after a failed RoundTrip, want 0", n)
+	}
+}
+
+func TestInstrumentRoundTripperDuration(t *testing.T) {
+	obs := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "test_request_duration_seconds",
+	}, []string{"method"})
+
+	rt := InstrumentRoundTripperDuration(obs, RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+
+	m, err := obs.GetMetricWith(prometheus.Labels{"method": "get"})
+	if err != nil {
+		t.Fatalf("GetMetricWith: %v", err)
+	}
+	var pm dto.Metric
+	if err := m.(prometheus.Metric).Write(&pm); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := pm.GetHistogram().GetSampleCount(); got != 1 {
+		t.Errorf("sample count = %d, want 1", got)
+	}
+}
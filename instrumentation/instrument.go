@@ -3,13 +3,9 @@ package instrumentation
 import (
 	"github.com/prometheus/client_golang/prometheus"
 
-	"bufio"
-	"io"
-	"net"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 )
 
 // InstrumentHandler wraps the given HTTP handler for instrumentation. It
@@ -21,20 +17,16 @@ import (
 // value. http_requests_total is a metric vector partitioned by HTTP method
 // (label name "method") and HTTP status code (label name "code").
 //
-// Deprecated: InstrumentHandler has several issues:
-//
-// - It uses Summaries rather than Histograms. Summaries are not useful if
+// Deprecated: InstrumentHandler uses a Summary rather than a Histogram for
+// response size. Summaries are not useful if
 // aggregation across multiple instances is required.
 //
-// - The size of the request is calculated in a separate goroutine. Since this
-// calculator requires access to the request header, it creates a race with
-// any writes to the header performed during request handling.
-// httputil.ReverseProxy is a prominent example for a handler
-// performing such writes.
-//
-// Upcoming versions of this package will provide ways of instrumenting HTTP
-// handlers that are more flexible and have fewer issues. Please prefer direct
-// instrumentation in the meantime.
+// Prefer InstrumentHandlerWithOptions, or the single-purpose
+// InstrumentHandlerCounter, InstrumentHandlerDuration, InstrumentHandlerInFlight,
+// InstrumentHandlerRequestSize and InstrumentHandlerResponseSize middlewares,
+// which use Histograms and let you supply your own collectors (custom
+// buckets, shared collectors across handlers, or skipping metrics you don't
+// want).
 func InstrumentHandler(handlerName string, handler http.Handler) http.HandlerFunc {
 	return InstrumentHandlerFunc(handlerName, handler.ServeHTTP)
 }
@@ -97,18 +89,16 @@ var instLabels = []string{"method", "code"}
 // Deprecated: InstrumentHandlerFuncWithOpts is deprecated for the same reasons
 // as InstrumentHandler is.
 func InstrumentHandlerFuncWithOpts(opts prometheus.Opts, handlerFunc func(http.ResponseWriter, *http.Request)) http.HandlerFunc {
-	inFlightReq := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: opts.Namespace,
-			Subsystem: opts.Subsystem,
-			Name:      "inflight_requests",
-			Help:      "In-flight HTTP requests.",
-		},
-		[]string{"method"},
-	)
+	inFlightReq := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   opts.Namespace,
+		Subsystem:   opts.Subsystem,
+		Name:        "inflight_requests",
+		Help:        "In-flight HTTP requests.",
+		ConstLabels: opts.ConstLabels,
+	})
 	if err := prometheus.Register(inFlightReq); err != nil {
 		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
-			inFlightReq = are.ExistingCollector.(*prometheus.GaugeVec)
+			inFlightReq = are.ExistingCollector.(prometheus.Gauge)
 		} else {
 			panic(err)
 		}
@@ -132,160 +122,76 @@ func InstrumentHandlerFuncWithOpts(opts prometheus.Opts, handlerFunc func(http.R
 		}
 	}
 
-	reqDur := prometheus.NewHistogram(prometheus.HistogramOpts{
-		Namespace: opts.Namespace,
-		Subsystem: opts.Subsystem,
-		Name:      "request_duration_seconds",
-		Help:      "The HTTP request latencies in seconds.",
-		Buckets: []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7,
-			0.8, 0.9, 1., 2., 5., 10., 20., 30., 40., 50.},
-	})
+	reqDur := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   opts.Namespace,
+		Subsystem:   opts.Subsystem,
+		Name:        "request_duration_seconds",
+		Help:        "The HTTP request latencies in seconds.",
+		ConstLabels: opts.ConstLabels,
+		Buckets:     defaultDurationBuckets,
+	}, []string{})
 	if err := prometheus.Register(reqDur); err != nil {
 		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
-			reqDur = are.ExistingCollector.(prometheus.Histogram)
+			reqDur = are.ExistingCollector.(*prometheus.HistogramVec)
 		} else {
 			panic(err)
 		}
 	}
 
-	//opts.Name = "request_size_bytes"
-	//opts.Help = "The HTTP request sizes in bytes."
-	//reqSz := prometheus.NewSummary(opts)
-	//if err := prometheus.Register(reqSz); err != nil {
-	//	if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
-	//		reqSz = are.ExistingCollector.(prometheus.Summary)
-	//	} else {
-	//		panic(err)
-	//	}
-	//}
-
-	resSz := prometheus.NewSummary(prometheus.SummaryOpts{
+	resSz := prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace:   opts.Namespace,
 		Subsystem:   opts.Subsystem,
 		Name:        "response_size_bytes",
 		Help:        "The HTTP response sizes in bytes.",
 		ConstLabels: opts.ConstLabels,
 		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
-	})
+	}, []string{})
 	if err := prometheus.Register(resSz); err != nil {
 		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
-			resSz = are.ExistingCollector.(prometheus.Summary)
+			resSz = are.ExistingCollector.(*prometheus.SummaryVec)
 		} else {
 			panic(err)
 		}
 	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		now := time.Now()
-		method := sanitizeMethod(r.Method)
-		f := inFlightReq.WithLabelValues(r.Method)
-		f.Inc()
-		defer f.Dec()
-
-		delegate := &responseWriterDelegator{ResponseWriter: w}
-		//out := computeApproximateRequestSize(r)
-
-		_, cn := w.(http.CloseNotifier)
-		_, fl := w.(http.Flusher)
-		_, hj := w.(http.Hijacker)
-		_, rf := w.(io.ReaderFrom)
-		var rw http.ResponseWriter
-		if cn && fl && hj && rf {
-			rw = &fancyResponseWriterDelegator{delegate}
-		} else {
-			rw = delegate
-		}
-		handlerFunc(rw, r)
-
-		elapsed := float64(time.Since(now)) / float64(time.Second)
-		code := sanitizeCode(delegate.status)
-		reqCnt.WithLabelValues(method, code).Inc()
-		reqDur.Observe(elapsed)
-		resSz.Observe(float64(delegate.written))
-		//reqSz.Observe(float64(<-out))
-	})
-}
-
-type responseWriterDelegator struct {
-	http.ResponseWriter
-
-	handler, method string
-	status          int
-	written         int64
-	wroteHeader     bool
-}
-
-func (r *responseWriterDelegator) WriteHeader(code int) {
-	r.status = code
-	r.wroteHeader = true
-	r.ResponseWriter.WriteHeader(code)
-}
-
-func (r *responseWriterDelegator) Write(b []byte) (int, error) {
-	if !r.wroteHeader {
-		r.WriteHeader(http.StatusOK)
-	}
-	n, err := r.ResponseWriter.Write(b)
-	r.written += int64(n)
-	return n, err
-}
-
-type fancyResponseWriterDelegator struct {
-	*responseWriterDelegator
-}
-
-func (f *fancyResponseWriterDelegator) CloseNotify() <-chan bool {
-	return f.ResponseWriter.(http.CloseNotifier).CloseNotify()
-}
-
-func (f *fancyResponseWriterDelegator) Flush() {
-	f.ResponseWriter.(http.Flusher).Flush()
-}
-
-func (f *fancyResponseWriterDelegator) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	return f.ResponseWriter.(http.Hijacker).Hijack()
-}
-
-func (f *fancyResponseWriterDelegator) ReadFrom(r io.Reader) (int64, error) {
-	if !f.wroteHeader {
-		f.WriteHeader(http.StatusOK)
-	}
-	n, err := f.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
-	f.written += n
-	return n, err
+	// Wire the single-purpose middlewares together, innermost first. The
+	// in-flight gauge is not partitioned by method, and no request size is
+	// observed.
+	handler := http.Handler(http.HandlerFunc(handlerFunc))
+	handler = InstrumentHandlerResponseSize(resSz, handler)
+	handler = InstrumentHandlerDuration(reqDur, handler)
+	handler = InstrumentHandlerCounter(reqCnt, handler)
+	handler = InstrumentHandlerInFlight(inFlightReq, handler)
+	return handler.(http.HandlerFunc)
 }
 
-func computeApproximateRequestSize(r *http.Request) <-chan int {
-	// Get URL length in current go routine for avoiding a race condition.
-	// HandlerFunc that runs in parallel may modify the URL.
+// computeApproximateRequestSize returns an approximation of the wire size of
+// r. It must be called before the request reaches the handler: r.Header may
+// be mutated concurrently by the handler (httputil.ReverseProxy is a
+// prominent example), so reading it anywhere but synchronously up front is a
+// race.
+func computeApproximateRequestSize(r *http.Request) int64 {
 	s := 0
 	if r.URL != nil {
 		s += len(r.URL.String())
 	}
 
-	out := make(chan int, 1)
-
-	go func() {
-		s += len(r.Method)
-		s += len(r.Proto)
-		for name, values := range r.Header {
-			s += len(name)
-			for _, value := range values {
-				s += len(value)
-			}
+	s += len(r.Method)
+	s += len(r.Proto)
+	for name, values := range r.Header {
+		s += len(name)
+		for _, value := range values {
+			s += len(value)
 		}
-		s += len(r.Host)
+	}
+	s += len(r.Host)
 
-		// N.B. r.Form and r.MultipartForm are assumed to be included in r.URL.
+	// N.B. r.Form and r.MultipartForm are assumed to be included in r.URL.
 
-		if r.ContentLength != -1 {
-			s += int(r.ContentLength)
-		}
-		out <- s
-		close(out)
-	}()
-
-	return out
+	if r.ContentLength != -1 {
+		s += int(r.ContentLength)
+	}
+	return int64(s)
 }
 
 func sanitizeMethod(m string) string {
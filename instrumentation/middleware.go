@@ -0,0 +1,221 @@
+package instrumentation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// InstrumentHandlerInFlight is a middleware that wraps the provided
+// http.Handler to observe the number of in-flight requests with the
+// provided prometheus.Gauge. Use this with a handler that is not wrapped
+// with any other request-scoped instrumentation (the gauge is agnostic to
+// method, code, or handler labels).
+func InstrumentHandlerInFlight(g prometheus.Gauge, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g.Inc()
+		defer g.Dec()
+		next.ServeHTTP(w, r)
+	}
+}
+
+// InstrumentHandlerCounter is a middleware that wraps the provided
+// http.Handler to observe the request result with the provided CounterVec.
+// Partitioning happens by HTTP status code and/or HTTP method if the
+// CounterVec has a "code" and/or "method" label. For unpartitioned
+// counting, use a CounterVec with zero labels.
+//
+// If the wrapped Handler panics, the Counter is still incremented before the
+// panic is re-raised. If the CounterVec has a "code" label, it is
+// incremented with the status code the client actually saw before the panic.
+func InstrumentHandlerCounter(counter *prometheus.CounterVec, next http.Handler) http.HandlerFunc {
+	code, method := checkLabels(counter)
+
+	if !code {
+		return func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				counter.With(labels(code, method, r.Method, 0)).Inc()
+				if p := recover(); p != nil {
+					panic(p)
+				}
+			}()
+
+			next.ServeHTTP(w, r)
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := 0
+		d := newDelegator(w, func(s int) { status = s })
+
+		defer func() {
+			counter.With(labels(code, method, r.Method, status)).Inc()
+			if p := recover(); p != nil {
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(d, r)
+	}
+}
+
+// InstrumentHandlerDuration is a middleware that wraps the provided
+// http.Handler to observe the request duration with the provided
+// ObserverVec. Partitioning happens by HTTP status code and/or HTTP method
+// if the ObserverVec has a "code" and/or "method" label.
+//
+// If the wrapped Handler panics, the duration is still observed before the
+// panic is re-raised. If the ObserverVec has a "code" label, it is observed
+// against the status code the client actually saw before the panic.
+func InstrumentHandlerDuration(obs prometheus.ObserverVec, next http.Handler) http.HandlerFunc {
+	code, method := checkLabels(obs)
+
+	if !code {
+		return func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+
+			defer func() {
+				obs.With(labels(code, method, r.Method, 0)).Observe(time.Since(now).Seconds())
+				if p := recover(); p != nil {
+					panic(p)
+				}
+			}()
+
+			next.ServeHTTP(w, r)
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		status := 0
+		d := newDelegator(w, func(s int) { status = s })
+
+		defer func() {
+			obs.With(labels(code, method, r.Method, status)).Observe(time.Since(now).Seconds())
+			if p := recover(); p != nil {
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(d, r)
+	}
+}
+
+// InstrumentHandlerResponseSize is a middleware that wraps the provided
+// http.Handler to observe the response size with the provided ObserverVec.
+// Partitioning happens by HTTP status code and/or HTTP method if the
+// ObserverVec has a "code" and/or "method" label.
+func InstrumentHandlerResponseSize(obs prometheus.ObserverVec, next http.Handler) http.Handler {
+	code, method := checkLabels(obs)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := newDelegator(w, nil)
+		next.ServeHTTP(d, r)
+		obs.With(labels(code, method, r.Method, d.Status())).Observe(float64(d.Written()))
+	})
+}
+
+// InstrumentHandlerRequestSize is a middleware that wraps the provided
+// http.Handler to observe the request size with the provided ObserverVec.
+// Partitioning happens by HTTP status code and/or HTTP method if the
+// ObserverVec has a "code" and/or "method" label.
+func InstrumentHandlerRequestSize(obs prometheus.ObserverVec, next http.Handler) http.Handler {
+	code, method := checkLabels(obs)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size := computeApproximateRequestSize(r)
+
+		if !code {
+			next.ServeHTTP(w, r)
+			obs.With(labels(code, method, r.Method, 0)).Observe(float64(size))
+			return
+		}
+
+		d := newDelegator(w, nil)
+		next.ServeHTTP(d, r)
+		obs.With(labels(code, method, r.Method, d.Status())).Observe(float64(size))
+	})
+}
+
+// magicString is used to determine whether a given label is present in a
+// Collector's Desc by checking whether its value equals this string when
+// constructing a dummy metric for it.
+const magicString = "zZgWfBxLqvG7zkq9avTwclBBei2AmJBAATrk+SCQKJbx+d4Jv4EW0vWlA0EJV0qw"
+
+// checkLabels reports whether the given Collector declares "code" and/or
+// "method" variable labels in its Desc. Instrumentation middlewares use it
+// to decide whether they need to pay the cost of capturing the status code
+// (which requires wrapping the ResponseWriter) and which labels to set when
+// observing.
+//
+// "handler" is deliberately not among the labels recognized here: a
+// handler's name is constant for a given wrapped Handler, so it belongs in
+// the Collector's ConstLabels, not as a variable label. checkLabels panics
+// if it finds "handler" declared as a variable label, rather than letting
+// the CounterVec/ObserverVec panic on the first With call with a confusing
+// "inconsistent label cardinality" error.
+func checkLabels(c prometheus.Collector) (code bool, method bool) {
+	var (
+		desc *prometheus.Desc
+		m    prometheus.Metric
+		pm   dto.Metric
+		lvs  []string
+	)
+
+	descc := make(chan *prometheus.Desc, 1)
+	c.Describe(descc)
+
+	select {
+	case desc = <-descc:
+	default:
+		panic("instrumentation: no description provided by collector")
+	}
+	select {
+	case <-descc:
+		panic("instrumentation: more than one description provided by collector")
+	default:
+	}
+	close(descc)
+
+	// Construct a dummy metric from the Desc, growing the list of variable
+	// label values until it succeeds, then inspect which of the resulting
+	// labels carry our magic value: those are the variable labels.
+	for err := errors.New("dummy"); err != nil; lvs = append(lvs, magicString) {
+		m, err = prometheus.NewConstMetric(desc, prometheus.UntypedValue, 0, lvs...)
+	}
+
+	if err := m.Write(&pm); err != nil {
+		panic(fmt.Errorf("instrumentation: error checking metric for labels: %s", err))
+	}
+	for _, label := range pm.Label {
+		if label.GetValue() != magicString {
+			continue
+		}
+		switch label.GetName() {
+		case "code":
+			code = true
+		case "method":
+			method = true
+		case "handler":
+			panic("instrumentation: \"handler\" must be a ConstLabel, not a variable label; see Options.Labels")
+		}
+	}
+	return
+}
+
+// labels builds the prometheus.Labels to use when observing a request,
+// only populating the labels the Collector actually declared.
+func labels(code, method bool, reqMethod string, status int) prometheus.Labels {
+	l := prometheus.Labels{}
+	if code {
+		l["code"] = sanitizeCode(status)
+	}
+	if method {
+		l["method"] = sanitizeMethod(reqMethod)
+	}
+	return l
+}
@@ -0,0 +1,36 @@
+package instrumentation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestInstrumentHandlerRequestSizeNoRace mirrors httputil.ReverseProxy, which
+// rewrites r.Header from within ServeHTTP. computeApproximateRequestSize
+// used to read r.Header concurrently from a goroutine, racing with writes
+// like this one. Run with -race to catch a regression.
+func TestInstrumentHandlerRequestSizeNoRace(t *testing.T) {
+	obs := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "test_request_size_bytes",
+	}, []string{})
+
+	mutateHeader := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("X-Added-By-Handler", "yes")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := InstrumentHandlerRequestSize(obs, mutateHeader)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Initial", "value")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
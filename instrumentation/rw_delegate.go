@@ -7,74 +7,658 @@ import (
 	"net/http"
 )
 
-type stats struct {
-	handler, method string
-	status          int
-	written         int64
-	wroteHeader     bool
-}
-
-type rwShared struct {
-	inner http.ResponseWriter
-	stats *stats
-}
+// Capability bits describing which optional http.ResponseWriter interfaces a
+// wrapped writer implements. newDelegator ORs these together to index into
+// pickDelegator.
+const (
+	closeNotifier = 1 << iota
+	flusher
+	hijacker
+	readerFrom
+	pusher
+	stringWriter
+)
 
-type rwH1 struct{ rwShared }
-type rwH2 struct{ rwShared }
+// Delegator is implemented by every value returned from newDelegator. Besides
+// the captured status code and byte count, a concrete Delegator exposes
+// exactly the combination of CloseNotifier, Flusher, Hijacker, io.ReaderFrom,
+// http.Pusher and io.StringWriter that the wrapped http.ResponseWriter
+// itself implements.
+type Delegator interface {
+	http.ResponseWriter
 
-type stringWriter interface {
-	WriteString(s string) (n int, err error)
+	Status() int
+	Written() int64
+	WroteHeader() bool
 }
 
-func (r *rwShared) Header() http.Header {
-	return r.inner.Header()
-}
+type responseWriterDelegator struct {
+	http.ResponseWriter
 
-func (r *rwShared) WriteHeader(code int) {
-	r.stats.status = code
-	r.stats.wroteHeader = true
-	r.inner.WriteHeader(code)
+	handler, method    string
+	status             int
+	written            int64
+	wroteHeader        bool
+	observeWriteHeader func(int)
 }
 
-func (r *rwShared) Write(b []byte) (int, error) {
-	if !r.stats.wroteHeader {
-		r.WriteHeader(http.StatusOK)
+func (r *responseWriterDelegator) WriteHeader(code int) {
+	r.status = code
+	r.wroteHeader = true
+	r.ResponseWriter.WriteHeader(code)
+	if r.observeWriteHeader != nil {
+		r.observeWriteHeader(code)
 	}
-	n, err := r.inner.Write(b)
-	r.stats.written += int64(n)
-	return n, err
 }
 
-func (r *rwShared) WriteString(s string) (int, error) {
-	if !r.stats.wroteHeader {
+func (r *responseWriterDelegator) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
 		r.WriteHeader(http.StatusOK)
 	}
-	n, err := r.inner.(stringWriter).WriteString(s)
-	r.stats.written += int64(n)
+	n, err := r.ResponseWriter.Write(b)
+	r.written += int64(n)
 	return n, err
 }
 
-func (r *rwShared) CloseNotify() <-chan bool {
-	return r.inner.(http.CloseNotifier).CloseNotify()
+func (r *responseWriterDelegator) Status() int {
+	return r.status
 }
 
-func (r *rwShared) Flush() {
-	r.inner.(http.Flusher).Flush()
+func (r *responseWriterDelegator) Written() int64 {
+	return r.written
 }
 
-func (r *rwH1) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	return r.inner.(http.Hijacker).Hijack()
+func (r *responseWriterDelegator) WroteHeader() bool {
+	return r.wroteHeader
 }
 
-func (r *rwH1) ReadFrom(reader io.Reader) (int64, error) {
-	if !r.stats.wroteHeader {
-		r.WriteHeader(http.StatusOK)
+type closeNotifierDelegator struct{ *responseWriterDelegator }
+type flusherDelegator struct{ *responseWriterDelegator }
+type hijackerDelegator struct{ *responseWriterDelegator }
+type readerFromDelegator struct{ *responseWriterDelegator }
+type pusherDelegator struct{ *responseWriterDelegator }
+type stringWriterDelegator struct{ *responseWriterDelegator }
+
+func (d closeNotifierDelegator) CloseNotify() <-chan bool {
+	return d.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+func (d flusherDelegator) Flush() {
+	d.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (d hijackerDelegator) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return d.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (d readerFromDelegator) ReadFrom(rd io.Reader) (int64, error) {
+	if !d.wroteHeader {
+		d.WriteHeader(http.StatusOK)
+	}
+	n, err := d.ResponseWriter.(io.ReaderFrom).ReadFrom(rd)
+	d.written += n
+	return n, err
+}
+
+func (d pusherDelegator) Push(target string, opts *http.PushOptions) error {
+	return d.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+func (d stringWriterDelegator) WriteString(s string) (int, error) {
+	if !d.wroteHeader {
+		d.WriteHeader(http.StatusOK)
 	}
-	n, err := r.inner.(io.ReaderFrom).ReadFrom(reader)
-	r.stats.written += n
+	n, err := d.ResponseWriter.(io.StringWriter).WriteString(s)
+	d.written += int64(n)
 	return n, err
 }
 
-func (r *rwH2) Push(target string, opts *http.PushOptions) error {
-	return r.inner.(http.Pusher).Push(target, opts)
+// pickDelegator is indexed by the OR of the capability bits above. It is
+// populated once at init time with every one of the 1<<6 combinations, each
+// entry a small struct embedding *responseWriterDelegator plus exactly the
+// optional interfaces its bit pattern calls for.
+var pickDelegator [1 << 6]func(*responseWriterDelegator) Delegator
+
+func init() {
+	pickDelegator[0] = func(d *responseWriterDelegator) Delegator { return d }
+	pickDelegator[closeNotifier] = func(d *responseWriterDelegator) Delegator {
+		return closeNotifierDelegator{d}
+	}
+	pickDelegator[flusher] = func(d *responseWriterDelegator) Delegator {
+		return flusherDelegator{d}
+	}
+	pickDelegator[closeNotifier+flusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}}
+	}
+	pickDelegator[hijacker] = func(d *responseWriterDelegator) Delegator {
+		return hijackerDelegator{d}
+	}
+	pickDelegator[closeNotifier+hijacker] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Hijacker
+		}{d, closeNotifierDelegator{d}, hijackerDelegator{d}}
+	}
+	pickDelegator[flusher+hijacker] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			http.Hijacker
+		}{d, flusherDelegator{d}, hijackerDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+hijacker] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			http.Hijacker
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, hijackerDelegator{d}}
+	}
+	pickDelegator[readerFrom] = func(d *responseWriterDelegator) Delegator {
+		return readerFromDelegator{d}
+	}
+	pickDelegator[closeNotifier+readerFrom] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			io.ReaderFrom
+		}{d, closeNotifierDelegator{d}, readerFromDelegator{d}}
+	}
+	pickDelegator[flusher+readerFrom] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			io.ReaderFrom
+		}{d, flusherDelegator{d}, readerFromDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+readerFrom] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			io.ReaderFrom
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, readerFromDelegator{d}}
+	}
+	pickDelegator[hijacker+readerFrom] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Hijacker
+			io.ReaderFrom
+		}{d, hijackerDelegator{d}, readerFromDelegator{d}}
+	}
+	pickDelegator[closeNotifier+hijacker+readerFrom] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Hijacker
+			io.ReaderFrom
+		}{d, closeNotifierDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}}
+	}
+	pickDelegator[flusher+hijacker+readerFrom] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{d, flusherDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+hijacker+readerFrom] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}}
+	}
+
+	// Every combination above again, this time with Pusher added, for HTTP/2
+	// response writers. Each entry embeds the concrete capability delegator
+	// types directly, same as the block above it — embedding the already-built
+	// Delegator interface value here would only promote the methods declared
+	// on the Delegator interface itself, silently dropping CloseNotify/Flush/
+	// Hijack/ReadFrom for any writer that also implements Pusher.
+	pickDelegator[pusher] = func(d *responseWriterDelegator) Delegator {
+		return pusherDelegator{d}
+	}
+	pickDelegator[closeNotifier+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Pusher
+		}{d, closeNotifierDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[flusher+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			http.Pusher
+		}{d, flusherDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			http.Pusher
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[hijacker+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Hijacker
+			http.Pusher
+		}{d, hijackerDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[closeNotifier+hijacker+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Hijacker
+			http.Pusher
+		}{d, closeNotifierDelegator{d}, hijackerDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[flusher+hijacker+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{d, flusherDelegator{d}, hijackerDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+hijacker+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, hijackerDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[readerFrom+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			io.ReaderFrom
+			http.Pusher
+		}{d, readerFromDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[closeNotifier+readerFrom+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			io.ReaderFrom
+			http.Pusher
+		}{d, closeNotifierDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[flusher+readerFrom+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+		}{d, flusherDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+readerFrom+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[hijacker+readerFrom+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{d, hijackerDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[closeNotifier+hijacker+readerFrom+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{d, closeNotifierDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[flusher+hijacker+readerFrom+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{d, flusherDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+hijacker+readerFrom+pusher] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}}
+	}
+
+	// Every combination above again, this time with StringWriter added, for
+	// response writers that implement io.StringWriter (e.g. bufio.Writer-
+	// backed writers), so the optimized WriteString path survives wrapping.
+	// As with the Pusher block above, each entry embeds the concrete
+	// capability delegator types directly.
+	pickDelegator[stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return stringWriterDelegator{d}
+	}
+	pickDelegator[closeNotifier+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[flusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			io.StringWriter
+		}{d, flusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[hijacker+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Hijacker
+			io.StringWriter
+		}{d, hijackerDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+hijacker+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Hijacker
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, hijackerDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[flusher+hijacker+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			http.Hijacker
+			io.StringWriter
+		}{d, flusherDelegator{d}, hijackerDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+hijacker+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			http.Hijacker
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, hijackerDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[readerFrom+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			io.ReaderFrom
+			io.StringWriter
+		}{d, readerFromDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+readerFrom+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			io.ReaderFrom
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, readerFromDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[flusher+readerFrom+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			io.ReaderFrom
+			io.StringWriter
+		}{d, flusherDelegator{d}, readerFromDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+readerFrom+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			io.ReaderFrom
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, readerFromDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[hijacker+readerFrom+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Hijacker
+			io.ReaderFrom
+			io.StringWriter
+		}{d, hijackerDelegator{d}, readerFromDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+hijacker+readerFrom+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Hijacker
+			io.ReaderFrom
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[flusher+hijacker+readerFrom+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			io.StringWriter
+		}{d, flusherDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+hijacker+readerFrom+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Pusher
+			io.StringWriter
+		}{d, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Pusher
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[flusher+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			http.Pusher
+			io.StringWriter
+		}{d, flusherDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			http.Pusher
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[hijacker+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Hijacker
+			http.Pusher
+			io.StringWriter
+		}{d, hijackerDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+hijacker+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Hijacker
+			http.Pusher
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, hijackerDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[flusher+hijacker+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.StringWriter
+		}{d, flusherDelegator{d}, hijackerDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+hijacker+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, hijackerDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[readerFrom+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{d, readerFromDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+readerFrom+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[flusher+readerFrom+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{d, flusherDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+readerFrom+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[hijacker+readerFrom+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{d, hijackerDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+hijacker+readerFrom+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[flusher+hijacker+readerFrom+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{d, flusherDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+	pickDelegator[closeNotifier+flusher+hijacker+readerFrom+pusher+stringWriter] = func(d *responseWriterDelegator) Delegator {
+		return struct {
+			*responseWriterDelegator
+			http.CloseNotifier
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{d, closeNotifierDelegator{d}, flusherDelegator{d}, hijackerDelegator{d}, readerFromDelegator{d}, pusherDelegator{d}, stringWriterDelegator{d}}
+	}
+}
+
+// newDelegator probes w for the optional http.ResponseWriter interfaces it
+// implements (CloseNotifier, Flusher, Hijacker, io.ReaderFrom, http.Pusher,
+// io.StringWriter) and returns a Delegator matching its exact capability
+// set, so a downstream handler that streams, hijacks the connection,
+// pushes resources or writes strings keeps working no matter which
+// combination the underlying writer supports.
+//
+// If observeWriteHeader is non-nil, it is called with the status code the
+// instant the handler calls WriteHeader, before ServeHTTP returns. This lets
+// callers that need the status code as soon as it is known (streaming
+// metrics, tracing spans, slow-request logging) avoid waiting for the
+// handler to finish.
+func newDelegator(w http.ResponseWriter, observeWriteHeader func(int)) Delegator {
+	d := &responseWriterDelegator{ResponseWriter: w, observeWriteHeader: observeWriteHeader}
+
+	id := 0
+	if _, ok := w.(http.CloseNotifier); ok {
+		id += closeNotifier
+	}
+	if _, ok := w.(http.Flusher); ok {
+		id += flusher
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		id += hijacker
+	}
+	if _, ok := w.(io.ReaderFrom); ok {
+		id += readerFrom
+	}
+	if _, ok := w.(http.Pusher); ok {
+		id += pusher
+	}
+	if _, ok := w.(io.StringWriter); ok {
+		id += stringWriter
+	}
+
+	return pickDelegator[id](d)
 }
@@ -2,6 +2,7 @@ package instrumentation
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/fd/httpmiddlewarevet"
@@ -12,3 +13,37 @@ func TestResponseWriterConformance(t *testing.T) {
 		return InstrumentHandler("testing", h)
 	})
 }
+
+// plainResponseWriter implements only the bare http.ResponseWriter, letting
+// us probe newDelegator's handling of a writer with none of the optional
+// capabilities.
+type plainResponseWriter struct {
+	http.ResponseWriter
+}
+
+func TestNewDelegatorMatchesCapabilities(t *testing.T) {
+	rec := httptest.NewRecorder() // implements Flusher, but not Hijacker/CloseNotifier/ReaderFrom/Pusher.
+
+	d := newDelegator(rec, nil)
+	if _, ok := d.(http.Flusher); !ok {
+		t.Error("delegator for a Flusher-capable writer should implement http.Flusher")
+	}
+	if _, ok := d.(http.Hijacker); ok {
+		t.Error("delegator for a non-Hijacker writer should not implement http.Hijacker")
+	}
+
+	plain := newDelegator(plainResponseWriter{rec}, nil)
+	if _, ok := plain.(http.Flusher); ok {
+		t.Error("delegator for a plain ResponseWriter should not implement http.Flusher")
+	}
+
+	var gotStatus int
+	hooked := newDelegator(rec, func(s int) { gotStatus = s })
+	hooked.WriteHeader(http.StatusTeapot)
+	if hooked.Status() != http.StatusTeapot {
+		t.Errorf("Status() = %d, want %d", hooked.Status(), http.StatusTeapot)
+	}
+	if gotStatus != http.StatusTeapot {
+		t.Errorf("observeWriteHeader callback got %d, want %d", gotStatus, http.StatusTeapot)
+	}
+}
@@ -0,0 +1,140 @@
+package instrumentation
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentTrace holds hook functions for phases of the HTTP client request
+// lifecycle, each receiving the number of seconds elapsed since the request
+// started. A nil field is simply not invoked. Use it with
+// InstrumentRoundTripperTrace for fine-grained, phase-level latency
+// reporting (DNS lookup, connect, TLS handshake, first response byte, ...).
+type InstrumentTrace struct {
+	GotConn              func(t float64)
+	PutIdleConn          func(t float64)
+	GotFirstResponseByte func(t float64)
+	Got100Continue       func(t float64)
+	DNSStart             func(t float64)
+	DNSDone              func(t float64)
+	ConnectStart         func(t float64)
+	ConnectDone          func(t float64)
+	TLSHandshakeStart    func(t float64)
+	TLSHandshakeDone     func(t float64)
+	WroteHeaders         func(t float64)
+	Wait100Continue      func(t float64)
+	WroteRequest         func(t float64)
+}
+
+// InstrumentRoundTripperTrace is a middleware that wraps the provided
+// RoundTripper and installs an httptrace.ClientTrace on every request's
+// context, reporting elapsed time since the request started to the hook
+// functions set on it. Hook functions that are not set are not invoked.
+func InstrumentRoundTripperTrace(it *InstrumentTrace, next http.RoundTripper) RoundTripperFunc {
+	return func(r *http.Request) (*http.Response, error) {
+		start := time.Now()
+
+		trace := &httptrace.ClientTrace{
+			GotConn: func(_ httptrace.GotConnInfo) {
+				if it.GotConn != nil {
+					it.GotConn(time.Since(start).Seconds())
+				}
+			},
+			PutIdleConn: func(err error) {
+				if err == nil && it.PutIdleConn != nil {
+					it.PutIdleConn(time.Since(start).Seconds())
+				}
+			},
+			DNSStart: func(_ httptrace.DNSStartInfo) {
+				if it.DNSStart != nil {
+					it.DNSStart(time.Since(start).Seconds())
+				}
+			},
+			DNSDone: func(_ httptrace.DNSDoneInfo) {
+				if it.DNSDone != nil {
+					it.DNSDone(time.Since(start).Seconds())
+				}
+			},
+			ConnectStart: func(_, _ string) {
+				if it.ConnectStart != nil {
+					it.ConnectStart(time.Since(start).Seconds())
+				}
+			},
+			ConnectDone: func(_, _ string, err error) {
+				if err == nil && it.ConnectDone != nil {
+					it.ConnectDone(time.Since(start).Seconds())
+				}
+			},
+			GotFirstResponseByte: func() {
+				if it.GotFirstResponseByte != nil {
+					it.GotFirstResponseByte(time.Since(start).Seconds())
+				}
+			},
+			Got100Continue: func() {
+				if it.Got100Continue != nil {
+					it.Got100Continue(time.Since(start).Seconds())
+				}
+			},
+			TLSHandshakeStart: func() {
+				if it.TLSHandshakeStart != nil {
+					it.TLSHandshakeStart(time.Since(start).Seconds())
+				}
+			},
+			TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+				if err == nil && it.TLSHandshakeDone != nil {
+					it.TLSHandshakeDone(time.Since(start).Seconds())
+				}
+			},
+			WroteHeaders: func() {
+				if it.WroteHeaders != nil {
+					it.WroteHeaders(time.Since(start).Seconds())
+				}
+			},
+			Wait100Continue: func() {
+				if it.Wait100Continue != nil {
+					it.Wait100Continue(time.Since(start).Seconds())
+				}
+			},
+			WroteRequest: func(_ httptrace.WroteRequestInfo) {
+				if it.WroteRequest != nil {
+					it.WroteRequest(time.Since(start).Seconds())
+				}
+			},
+		}
+
+		return next.RoundTrip(r.WithContext(httptrace.WithClientTrace(r.Context(), trace)))
+	}
+}
+
+// NewInstrumentTrace builds an InstrumentTrace that reports every phase to
+// obs, labelled by an "event" label carrying the phase name (e.g.
+// "dns_start", "connect_done", "tls_handshake_done"). obs must declare an
+// "event" variable label; use this to get phase-level latency observations
+// out of InstrumentRoundTripperTrace without writing out each hook by hand.
+func NewInstrumentTrace(obs prometheus.ObserverVec) *InstrumentTrace {
+	observe := func(event string) func(float64) {
+		return func(t float64) {
+			obs.With(prometheus.Labels{"event": event}).Observe(t)
+		}
+	}
+
+	return &InstrumentTrace{
+		GotConn:              observe("got_conn"),
+		PutIdleConn:          observe("put_idle_conn"),
+		GotFirstResponseByte: observe("got_first_response_byte"),
+		Got100Continue:       observe("got_100_continue"),
+		DNSStart:             observe("dns_start"),
+		DNSDone:              observe("dns_done"),
+		ConnectStart:         observe("connect_start"),
+		ConnectDone:          observe("connect_done"),
+		TLSHandshakeStart:    observe("tls_handshake_start"),
+		TLSHandshakeDone:     observe("tls_handshake_done"),
+		WroteHeaders:         observe("wrote_headers"),
+		Wait100Continue:      observe("wait_100_continue"),
+		WroteRequest:         observe("wrote_request"),
+	}
+}
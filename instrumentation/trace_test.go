@@ -0,0 +1,54 @@
+package instrumentation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// TestInstrumentRoundTripperTrace confirms InstrumentRoundTripperTrace
+// installs a ClientTrace that NewInstrumentTrace's hooks can observe
+// through, by firing GotConn from within the RoundTripper and checking it
+// lands in the "event"-labelled ObserverVec under "got_conn".
+func TestInstrumentRoundTripperTrace(t *testing.T) {
+	obs := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "test_trace_duration_seconds",
+	}, []string{"event"})
+
+	it := NewInstrumentTrace(obs)
+
+	var gotConnFired bool
+	rt := InstrumentRoundTripperTrace(it, RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		trace := httptrace.ContextClientTrace(r.Context())
+		if trace == nil {
+			t.Fatal("no ClientTrace installed on request context")
+		}
+		trace.GotConn(httptrace.GotConnInfo{})
+		gotConnFired = true
+		return httptest.NewRecorder().Result(), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if !gotConnFired {
+		t.Fatal("GotConn hook was never invoked")
+	}
+
+	m, err := obs.GetMetricWith(prometheus.Labels{"event": "got_conn"})
+	if err != nil {
+		t.Fatalf("GetMetricWith: %v", err)
+	}
+	var pm dto.Metric
+	if err := m.(prometheus.Metric).Write(&pm); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := pm.GetHistogram().GetSampleCount(); got != 1 {
+		t.Errorf("sample count = %d, want 1", got)
+	}
+}